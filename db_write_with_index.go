@@ -0,0 +1,104 @@
+package grocksdb
+
+// #include "rocksdb/c.h"
+import "C"
+
+import (
+	"strings"
+	"time"
+)
+
+// WriteWithIndex atomically applies wbwi to the database, the same way
+// Write applies a plain WriteBatch.
+func (db *DB) WriteWithIndex(opts *WriteOptions, wbwi *WriteBatchWI) (err error) {
+	var cErr *C.char
+	C.rocksdb_write_writebatch_wi(db.c, opts.c, wbwi.c, &cErr)
+	err = fromCError(cErr)
+	return
+}
+
+// CommitOptions configures DB.CommitBatch.
+type CommitOptions struct {
+	// Sync forces the write to be flushed to the WAL before returning.
+	Sync bool
+	// DisableWAL skips writing to the WAL entirely.
+	DisableWAL bool
+	// RetryOnBusy retries the commit when the write is rejected because the
+	// database can't keep up (write stalls: a full memtable or too many L0
+	// files) instead of returning the error immediately. This is backpressure
+	// from db itself, not conflict detection between writers - a plain
+	// WriteBatchWI commit has none - so it only has an effect paired with
+	// WriteOptions.SetNoSlowdown, which CommitBatch sets whenever
+	// RetryOnBusy is true; otherwise the write blocks instead of returning
+	// Busy and there is nothing to retry.
+	RetryOnBusy bool
+	// MaxRetries bounds the number of retries performed when RetryOnBusy is
+	// set. Zero means retry until the write succeeds.
+	MaxRetries int
+	// Backoff is the delay before each retry. Zero disables the delay.
+	Backoff time.Duration
+}
+
+// CommitStats reports bookkeeping about a DB.CommitBatch call.
+type CommitStats struct {
+	// BytesWritten is the size of the batch's serialized payload.
+	BytesWritten int
+	// Retries is the number of retries performed before the commit
+	// succeeded or MaxRetries was exhausted.
+	Retries int
+	// WALDuration is the time spent inside the underlying write call,
+	// across all attempts.
+	WALDuration time.Duration
+}
+
+// CommitBatch applies wbwi to db through the same write path as
+// WriteWithIndex, optionally retrying when the write is rejected as Busy
+// under write-stall backpressure (see CommitOptions.RetryOnBusy). Routing
+// every mutation - including ones that would otherwise be a direct
+// Put/Delete/Merge on db - through a WriteBatchWI and CommitBatch gives
+// callers a single write path, so a direct sync write can never bypass the
+// batch pipeline and skip WAL grouping.
+func (db *DB) CommitBatch(wbwi *WriteBatchWI, copts CommitOptions) (CommitStats, error) {
+	wo := NewDefaultWriteOptions()
+	defer wo.Destroy()
+	wo.SetSync(copts.Sync)
+	wo.DisableWAL(copts.DisableWAL)
+	wo.SetNoSlowdown(copts.RetryOnBusy)
+
+	stats := CommitStats{BytesWritten: len(wbwi.Data())}
+
+	for {
+		start := time.Now()
+		err := db.WriteWithIndex(wo, wbwi)
+		stats.WALDuration += time.Since(start)
+		if err == nil {
+			return stats, nil
+		}
+
+		if !copts.RetryOnBusy || !isBusyError(err) {
+			return stats, err
+		}
+		if copts.MaxRetries > 0 && stats.Retries >= copts.MaxRetries {
+			return stats, err
+		}
+
+		stats.Retries++
+		if copts.Backoff > 0 {
+			time.Sleep(copts.Backoff)
+		}
+	}
+}
+
+// isBusyError reports whether err is a RocksDB Status with code kBusy.
+// RocksDB's C API only surfaces a Status through Status::ToString(), which
+// renders that code as a "Busy: ..." (or bare "Busy", with no pending
+// submessage) prefix - checked here instead of a bare substring match,
+// which would misclassify any unrelated message that happens to contain
+// the word "Busy".
+func isBusyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return msg == "Busy" || strings.HasPrefix(msg, "Busy:")
+}
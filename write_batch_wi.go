@@ -3,6 +3,12 @@ package grocksdb
 // #include "rocksdb/c.h"
 import "C"
 
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
 // WriteBatchWI is a batching with index of Puts, Merges and Deletes to implement read-your-own-write.
 // See also: https://rocksdb.org/blog/2015/02/27/write-batch-with-index.html
 type WriteBatchWI struct {
@@ -23,6 +29,77 @@ func NewNativeWriteBatchWI(c *C.rocksdb_writebatch_wi_t) *WriteBatchWI {
 	return &WriteBatchWI{c}
 }
 
+// NewWriteBatchWIFromData reconstructs a WriteBatchWI from the bytes
+// previously returned by Data(), replaying each decoded default-column-
+// family record (Put, Merge, Delete, SingleDelete, DeleteRange) against a
+// fresh batch created with reservedBytes and overwriteKeys. A payload
+// containing a column-family record fails with an error; use
+// NewWriteBatchWIFromDataWithCF for batches that touch non-default column
+// families. PutLogData blobs are not part of a Put/Merge/Delete replay and
+// are dropped. WriteBatchWI exposes no single-delete method, so a
+// SingleDelete record is replayed via Delete (and a SingleDeleteCF record
+// via DeleteCF) - this reconstructs an
+// equivalent keyspace but downgrades the tombstone to a point deletion,
+// which is not byte-identical to the original record's semantics on apply.
+func NewWriteBatchWIFromData(data []byte, reservedBytes uint, overwriteKeys bool) (*WriteBatchWI, error) {
+	return newWriteBatchWIFromData(data, reservedBytes, overwriteKeys, nil)
+}
+
+// NewWriteBatchWIFromDataWithCF is like NewWriteBatchWIFromData but also
+// replays column-family records, resolving the column-family ids embedded
+// in data against cfs. A record naming an id absent from cfs fails with an
+// error.
+func NewWriteBatchWIFromDataWithCF(data []byte, reservedBytes uint, overwriteKeys bool, cfs map[uint32]*ColumnFamilyHandle) (*WriteBatchWI, error) {
+	return newWriteBatchWIFromData(data, reservedBytes, overwriteKeys, cfs)
+}
+
+func newWriteBatchWIFromData(data []byte, reservedBytes uint, overwriteKeys bool, cfs map[uint32]*ColumnFamilyHandle) (*WriteBatchWI, error) {
+	wb := NewWriteBatchWI(reservedBytes, overwriteKeys)
+
+	it := &WBWIIterator{cfs: cfs}
+	if len(data) >= 8+4 {
+		it.data = data[12:]
+	}
+
+	for it.Next() {
+		rec := it.Record()
+
+		switch rec.Kind {
+		case WBWIKindPut:
+			wb.Put(rec.Key, rec.Value)
+		case WBWIKindMerge:
+			wb.Merge(rec.Key, rec.Value)
+		case WBWIKindDelete, WBWIKindSingleDelete:
+			wb.Delete(rec.Key)
+		case WBWIKindDeleteRange:
+			wb.DeleteRange(rec.Key, rec.EndKey)
+		case WBWIKindPutCF, WBWIKindMergeCF, WBWIKindDeleteCF, WBWIKindSingleDeleteCF, WBWIKindDeleteRangeCF:
+			cf, ok := cfs[rec.CFID]
+			if !ok {
+				wb.Destroy()
+				return nil, fmt.Errorf("grocksdb: no column family handle for id %d", rec.CFID)
+			}
+			switch rec.Kind {
+			case WBWIKindPutCF:
+				wb.PutCF(cf, rec.Key, rec.Value)
+			case WBWIKindMergeCF:
+				wb.MergeCF(cf, rec.Key, rec.Value)
+			case WBWIKindDeleteCF, WBWIKindSingleDeleteCF:
+				wb.DeleteCF(cf, rec.Key)
+			case WBWIKindDeleteRangeCF:
+				wb.DeleteRangeCF(cf, rec.Key, rec.EndKey)
+			}
+		}
+	}
+
+	if err := it.Error(); err != nil {
+		wb.Destroy()
+		return nil, err
+	}
+
+	return wb, nil
+}
+
 // Put queues a key-value pair.
 func (wb *WriteBatchWI) Put(key, value []byte) {
 	cKey := byteToChar(key)
@@ -106,6 +183,212 @@ func (wb *WriteBatchWI) NewIterator() *WriteBatchIterator {
 	return &WriteBatchIterator{data: data[12:]}
 }
 
+// WBWIRecordKind identifies the RocksDB WriteBatch record tag decoded by
+// WBWIIterator. These mirror the ValueType tags RocksDB embeds in the
+// batch's serialized payload (see db/write_batch.cc).
+type WBWIRecordKind byte
+
+const (
+	WBWIKindDelete         WBWIRecordKind = 0x0
+	WBWIKindPut            WBWIRecordKind = 0x1
+	WBWIKindMerge          WBWIRecordKind = 0x2
+	WBWIKindLogData        WBWIRecordKind = 0x3
+	WBWIKindDeleteCF       WBWIRecordKind = 0x4
+	WBWIKindPutCF          WBWIRecordKind = 0x5
+	WBWIKindMergeCF        WBWIRecordKind = 0x6
+	WBWIKindSingleDelete   WBWIRecordKind = 0x7
+	WBWIKindSingleDeleteCF WBWIRecordKind = 0x8
+	WBWIKindDeleteRangeCF  WBWIRecordKind = 0xE
+	WBWIKindDeleteRange    WBWIRecordKind = 0xF
+)
+
+// WBWIRecord is a single decoded entry from a WriteBatchWI payload. CFID is
+// 0 for default-column-family records. EndKey is only populated for
+// DeleteRange/DeleteRangeCF records, where Key holds the range start.
+type WBWIRecord struct {
+	Kind   WBWIRecordKind
+	CFID   uint32
+	CF     *ColumnFamilyHandle
+	Key    []byte
+	Value  []byte
+	EndKey []byte
+}
+
+// WBWIIteratorOptions configures WriteBatchWI.NewIteratorWithCF.
+type WBWIIteratorOptions struct {
+	// IncludeLogData makes the iterator surface PutLogData records (as a
+	// WBWIRecord of kind WBWIKindLogData with Value set to the blob)
+	// instead of silently skipping them.
+	IncludeLogData bool
+}
+
+// WBWIIterator walks every record encoded in a WriteBatchWI payload. Unlike
+// WriteBatchIterator it decodes column family puts/merges/deletes, range
+// deletions, single deletions and log data, not just the classic
+// Put/Merge/Delete triad. Any other tag (such as a transaction marker)
+// stops iteration with an error.
+type WBWIIterator struct {
+	data   []byte
+	cfs    map[uint32]*ColumnFamilyHandle
+	opts   WBWIIteratorOptions
+	record WBWIRecord
+	err    error
+}
+
+// NewIteratorWithCF returns an iterator over every record in the batch,
+// including column-family puts/merges/deletes, range deletions and single
+// deletions. cfs resolves the column-family ids embedded in the batch to
+// their handles (default-column-family records carry id 0); a record whose
+// id is absent from cfs is returned with a nil CF. PutLogData records are skipped unless
+// opts.IncludeLogData is set.
+func (wb *WriteBatchWI) NewIteratorWithCF(cfs map[uint32]*ColumnFamilyHandle, opts WBWIIteratorOptions) *WBWIIterator {
+	data := wb.Data()
+	if len(data) < 8+4 {
+		return &WBWIIterator{cfs: cfs, opts: opts}
+	}
+	return &WBWIIterator{data: data[12:], cfs: cfs, opts: opts}
+}
+
+// Next decodes the next record, returning false once the batch is
+// exhausted or a decode error is hit (use Error to tell the two apart).
+func (it *WBWIIterator) Next() bool {
+	for len(it.data) > 0 {
+		tag := WBWIRecordKind(it.data[0])
+		it.data = it.data[1:]
+		rec := WBWIRecord{Kind: tag}
+
+		switch tag {
+		case WBWIKindPut:
+			rec.Key, it.err = it.decodeSlice()
+			if it.err == nil {
+				rec.Value, it.err = it.decodeSlice()
+			}
+		case WBWIKindPutCF:
+			rec.CFID, it.err = it.decodeCFID()
+			if it.err == nil {
+				rec.Key, it.err = it.decodeSlice()
+			}
+			if it.err == nil {
+				rec.Value, it.err = it.decodeSlice()
+			}
+		case WBWIKindMerge:
+			rec.Key, it.err = it.decodeSlice()
+			if it.err == nil {
+				rec.Value, it.err = it.decodeSlice()
+			}
+		case WBWIKindMergeCF:
+			rec.CFID, it.err = it.decodeCFID()
+			if it.err == nil {
+				rec.Key, it.err = it.decodeSlice()
+			}
+			if it.err == nil {
+				rec.Value, it.err = it.decodeSlice()
+			}
+		case WBWIKindDelete, WBWIKindSingleDelete:
+			rec.Key, it.err = it.decodeSlice()
+		case WBWIKindDeleteCF, WBWIKindSingleDeleteCF:
+			rec.CFID, it.err = it.decodeCFID()
+			if it.err == nil {
+				rec.Key, it.err = it.decodeSlice()
+			}
+		case WBWIKindDeleteRange:
+			rec.Key, it.err = it.decodeSlice()
+			if it.err == nil {
+				rec.EndKey, it.err = it.decodeSlice()
+			}
+		case WBWIKindDeleteRangeCF:
+			rec.CFID, it.err = it.decodeCFID()
+			if it.err == nil {
+				rec.Key, it.err = it.decodeSlice()
+			}
+			if it.err == nil {
+				rec.EndKey, it.err = it.decodeSlice()
+			}
+		case WBWIKindLogData:
+			rec.Value, it.err = it.decodeSlice()
+			if it.err == nil && !it.opts.IncludeLogData {
+				continue
+			}
+		default:
+			it.err = errors.New("grocksdb: unsupported write batch record tag")
+		}
+
+		if it.err != nil {
+			return false
+		}
+
+		if cf, ok := it.cfs[rec.CFID]; ok {
+			rec.CF = cf
+		}
+		it.record = rec
+		return true
+	}
+	return false
+}
+
+// Record returns the most recently decoded record; the next call to Next
+// overwrites it. Its slices alias the batch's underlying data rather than
+// copying it, so they are not affected by later calls to Next.
+func (it *WBWIIterator) Record() *WBWIRecord {
+	return &it.record
+}
+
+// Error returns the first error encountered while decoding, if any.
+func (it *WBWIIterator) Error() error {
+	return it.err
+}
+
+func (it *WBWIIterator) decodeCFID() (uint32, error) {
+	v, n := binary.Uvarint(it.data)
+	if n <= 0 {
+		return 0, errors.New("grocksdb: truncated write batch column family id")
+	}
+	it.data = it.data[n:]
+	return uint32(v), nil
+}
+
+func (it *WBWIIterator) decodeSlice() ([]byte, error) {
+	l, n := binary.Uvarint(it.data)
+	if n <= 0 || l > uint64(len(it.data)-n) {
+		return nil, errors.New("grocksdb: truncated write batch record")
+	}
+	it.data = it.data[n:]
+	s := it.data[:l]
+	it.data = it.data[l:]
+	return s, nil
+}
+
+// NewIteratorWithBase returns an iterator over this batch's pending writes
+// layered on top of db, giving read-your-own-writes semantics over an
+// uncommitted WriteBatchWI: keys Put/Merged/Deleted in the batch shadow
+// whatever db would otherwise return, while everything else falls through
+// to db. baseIter must have been created from db (e.g. via db.NewIterator);
+// it is consumed by this call and must not be used directly afterwards. If
+// baseIter is nil, one is created from db using opts. The returned Iterator
+// follows the usual Iterator lifecycle (Close, Valid, Seek, Next/Prev,
+// Key/Value).
+func (wb *WriteBatchWI) NewIteratorWithBase(db *DB, baseIter *Iterator, opts *ReadOptions) *Iterator {
+	if baseIter == nil {
+		baseIter = db.NewIterator(opts)
+	}
+	cIter := C.rocksdb_writebatch_wi_create_iterator_with_base(wb.c, baseIter.c)
+	baseIter.c = nil
+	return NewNativeIterator(cIter)
+}
+
+// NewIteratorWithBaseCF is like NewIteratorWithBase but merges the batch's
+// pending writes for a single column family with a base iterator (or, if
+// baseIter is nil, one created from db and cf using opts) over that same
+// column family.
+func (wb *WriteBatchWI) NewIteratorWithBaseCF(db *DB, cf *ColumnFamilyHandle, baseIter *Iterator, opts *ReadOptions) *Iterator {
+	if baseIter == nil {
+		baseIter = db.NewIteratorCF(opts, cf)
+	}
+	cIter := C.rocksdb_writebatch_wi_create_iterator_with_base_cf(wb.c, baseIter.c, cf.c)
+	baseIter.c = nil
+	return NewNativeIterator(cIter)
+}
+
 // SetSavePoint records the state of the batch for future calls to RollbackToSavePoint().
 // May be called multiple times to set multiple save points.
 func (wb *WriteBatchWI) SetSavePoint() {
@@ -187,6 +470,215 @@ func (wb *WriteBatchWI) GetFromDBWithCF(db *DB, opts *ReadOptions, cf *ColumnFam
 	return
 }
 
+// MultiGetFromDB is the batched form of GetFromDB: it decodes this batch's
+// pending writes once to resolve keys already Put or Deleted in the batch
+// without touching db, then issues a single DB.MultiGet for everything
+// else, instead of paying one cgo + read-options round-trip per key. Keys
+// with a pending Merge still go through GetFromDB individually, since
+// combining a queued merge operand with the base DB value requires the
+// merge operator and cannot be batched. The returned slices and errors are
+// in the same order as keys.
+func (wb *WriteBatchWI) MultiGetFromDB(db *DB, opts *ReadOptions, keys [][]byte) ([]*Slice, []error) {
+	return wb.multiGetFromDB(db, opts, nil, keys)
+}
+
+// MultiGetFromDBWithCF is like MultiGetFromDB but resolves every key
+// against a single column family.
+func (wb *WriteBatchWI) MultiGetFromDBWithCF(db *DB, opts *ReadOptions, cf *ColumnFamilyHandle, keys [][]byte) ([]*Slice, []error) {
+	return wb.multiGetFromDB(db, opts, cf, keys)
+}
+
+// MultiGetFromDBWithCFs is like MultiGetFromDBWithCF but resolves each key
+// against its own column family, cfs[i] corresponding to keys[i].
+func (wb *WriteBatchWI) MultiGetFromDBWithCFs(db *DB, opts *ReadOptions, cfs []*ColumnFamilyHandle, keys [][]byte) ([]*Slice, []error) {
+	slices := make([]*Slice, len(keys))
+	errs := make([]error, len(keys))
+
+	groups := make(map[*ColumnFamilyHandle][]int)
+	for i, cf := range cfs {
+		groups[cf] = append(groups[cf], i)
+	}
+
+	for cf, idxs := range groups {
+		groupKeys := make([][]byte, len(idxs))
+		for j, i := range idxs {
+			groupKeys[j] = keys[i]
+		}
+
+		groupSlices, groupErrs := wb.multiGetFromDB(db, opts, cf, groupKeys)
+		for j, i := range idxs {
+			slices[i] = groupSlices[j]
+			errs[i] = groupErrs[j]
+		}
+	}
+
+	return slices, errs
+}
+
+// wbwiKeyState is the last Put/Delete/Merge seen for a key in a single
+// column family while decoding a batch for multiGetFromDB.
+type wbwiKeyState struct {
+	deleted  bool
+	merged   bool
+	hasValue bool
+	value    []byte
+}
+
+// indexByCF decodes the batch once, returning the last Put/Delete/
+// SingleDelete/Merge seen for each key restricted to column family cfID (0
+// is the default column family). DeleteRange is not reflected here, since
+// it covers a range rather than a specific key; callers still see the
+// pre-batch value for keys covered only by a pending range deletion. It
+// returns a non-nil error if the batch payload fails to decode, in which
+// case the index must be treated as incomplete rather than authoritative.
+func (wb *WriteBatchWI) indexByCF(cfID uint32) (map[string]wbwiKeyState, error) {
+	idx := make(map[string]wbwiKeyState, wb.Count())
+
+	it := wb.NewIteratorWithCF(nil, WBWIIteratorOptions{})
+	for it.Next() {
+		rec := it.Record()
+
+		var recCF uint32
+		switch rec.Kind {
+		case WBWIKindPutCF, WBWIKindDeleteCF, WBWIKindMergeCF, WBWIKindSingleDeleteCF:
+			recCF = rec.CFID
+		}
+		if recCF != cfID {
+			continue
+		}
+
+		switch rec.Kind {
+		case WBWIKindPut, WBWIKindPutCF:
+			idx[string(rec.Key)] = wbwiKeyState{hasValue: true, value: rec.Value}
+		case WBWIKindDelete, WBWIKindDeleteCF, WBWIKindSingleDelete, WBWIKindSingleDeleteCF:
+			idx[string(rec.Key)] = wbwiKeyState{deleted: true}
+		case WBWIKindMerge, WBWIKindMergeCF:
+			idx[string(rec.Key)] = wbwiKeyState{merged: true}
+		}
+	}
+
+	return idx, it.Error()
+}
+
+func (wb *WriteBatchWI) multiGetFromDB(db *DB, opts *ReadOptions, cf *ColumnFamilyHandle, keys [][]byte) ([]*Slice, []error) {
+	idx, err := wb.indexByCF(cfHandleID(cf))
+	if err != nil {
+		errs := make([]error, len(keys))
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([]*Slice, len(keys)), errs
+	}
+
+	slices := make([]*Slice, len(keys))
+	errs := make([]error, len(keys))
+
+	var missIdxs []int
+	var missKeys [][]byte
+
+	for i, key := range keys {
+		st, ok := idx[string(key)]
+		switch {
+		case ok && st.deleted:
+			slices[i] = NewSlice(nil, 0)
+		case ok && st.hasValue:
+			// st.value aliases this batch's Data() buffer, not a malloc'd
+			// block. Copy it into one of its own so the returned Slice is
+			// independently freeable via Slice.Free - like the slices
+			// DB.MultiGet returns for the miss keys below - instead of
+			// pointing into, and outliving, batch memory.
+			cValue := (*C.char)(C.CBytes(st.value))
+			slices[i] = NewSlice(cValue, C.size_t(len(st.value)))
+		case ok && st.merged:
+			if cf != nil {
+				slices[i], errs[i] = wb.GetFromDBWithCF(db, opts, cf, key)
+			} else {
+				slices[i], errs[i] = wb.GetFromDB(db, opts, key)
+			}
+		default:
+			missIdxs = append(missIdxs, i)
+			missKeys = append(missKeys, key)
+		}
+	}
+
+	if len(missKeys) > 0 {
+		var dbSlices Slices
+		var dbErr error
+		if cf != nil {
+			dbSlices, dbErr = db.MultiGetWithCF(opts, cf, missKeys...)
+		} else {
+			dbSlices, dbErr = db.MultiGet(opts, missKeys...)
+		}
+		for j, i := range missIdxs {
+			if dbErr != nil {
+				errs[i] = dbErr
+				continue
+			}
+			slices[i] = dbSlices[j]
+		}
+	}
+
+	return slices, errs
+}
+
+func cfHandleID(cf *ColumnFamilyHandle) uint32 {
+	if cf == nil {
+		return 0
+	}
+	return uint32(C.rocksdb_column_family_handle_get_id(cf.c))
+}
+
+// ErrSkipRecord can be returned by a WriteBatchHandler callback to skip the
+// current record without aborting Iterate.
+var ErrSkipRecord = errors.New("grocksdb: skip record")
+
+// WriteBatchHandler receives a push-style callback for every record in a
+// WriteBatchWI, mirroring RocksDB's WriteBatch::Handler. Default-column-
+// family records are delivered with cf == 0. A callback may return
+// ErrSkipRecord to continue iteration without aborting it; any other
+// non-nil error stops Iterate and is returned to the caller.
+type WriteBatchHandler interface {
+	Put(cf uint32, key, value []byte) error
+	Merge(cf uint32, key, value []byte) error
+	Delete(cf uint32, key []byte) error
+	SingleDelete(cf uint32, key []byte) error
+	DeleteRange(cf uint32, start, end []byte) error
+	LogData(blob []byte) error
+}
+
+// Iterate walks every record in the batch, invoking the matching
+// WriteBatchHandler callback in order. Iteration stops at the first
+// callback error other than ErrSkipRecord, or at the first decode error.
+func (wb *WriteBatchWI) Iterate(h WriteBatchHandler) error {
+	it := wb.NewIteratorWithCF(nil, WBWIIteratorOptions{IncludeLogData: true})
+
+	for it.Next() {
+		rec := it.Record()
+
+		var err error
+		switch rec.Kind {
+		case WBWIKindPut, WBWIKindPutCF:
+			err = h.Put(rec.CFID, rec.Key, rec.Value)
+		case WBWIKindMerge, WBWIKindMergeCF:
+			err = h.Merge(rec.CFID, rec.Key, rec.Value)
+		case WBWIKindDelete, WBWIKindDeleteCF:
+			err = h.Delete(rec.CFID, rec.Key)
+		case WBWIKindSingleDelete, WBWIKindSingleDeleteCF:
+			err = h.SingleDelete(rec.CFID, rec.Key)
+		case WBWIKindDeleteRange, WBWIKindDeleteRangeCF:
+			err = h.DeleteRange(rec.CFID, rec.Key, rec.EndKey)
+		case WBWIKindLogData:
+			err = h.LogData(rec.Value)
+		}
+
+		if err != nil && err != ErrSkipRecord {
+			return err
+		}
+	}
+
+	return it.Error()
+}
+
 // Clear removes all the enqueued Put and Deletes.
 func (wb *WriteBatchWI) Clear() {
 	C.rocksdb_writebatch_wi_clear(wb.c)